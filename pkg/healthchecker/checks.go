@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"context"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/pkg/errors"
+)
+
+// PodSample is a single pod's parsed _status/vars scrape, along with enough
+// context for a Check to decide whether that pod is safe to continue a
+// rolling restart past.
+type PodSample struct {
+	PodName     string
+	Store       string
+	Families    map[string]*dto.MetricFamily
+	ClusterSize int32
+}
+
+// Check evaluates one CockroachDB health signal against a PodSample. On each
+// retry iteration Probe runs every registered Check against each pod in turn,
+// and surfaces all of a pod's failing checks together rather than stopping at
+// the first one; the iteration ends at the first pod with a failing check.
+type Check interface {
+	Name() string
+	Evaluate(ctx context.Context, sample PodSample) error
+}
+
+// defaultChecks is the chain NewHealthChecker wires up by default.
+func defaultChecks() []Check {
+	return []Check{
+		UnderReplicatedCheck{},
+		UnavailableRangesCheck{},
+		LiveNodesCheck{},
+		LeaseholderCheck{},
+	}
+}
+
+// UnderReplicatedCheck requires ranges_underreplicated for the pod's store to
+// be zero.
+type UnderReplicatedCheck struct{}
+
+func (UnderReplicatedCheck) Name() string { return "ranges_underreplicated" }
+
+func (c UnderReplicatedCheck) Evaluate(_ context.Context, sample PodSample) error {
+	value, err := underReplicatedRanges(sample.Families, sample.Store)
+	if err != nil {
+		return err
+	}
+	if value > 0 {
+		return errors.Errorf("ranges_underreplicated is %v for store %s", value, sample.Store)
+	}
+	return nil
+}
+
+// UnavailableRangesCheck requires ranges_unavailable for the pod's store to
+// be zero.
+type UnavailableRangesCheck struct{}
+
+func (UnavailableRangesCheck) Name() string { return "ranges_unavailable" }
+
+func (c UnavailableRangesCheck) Evaluate(_ context.Context, sample PodSample) error {
+	value, err := metricByStoreLabel(sample.Families, "ranges_unavailable", sample.Store)
+	if err != nil {
+		return err
+	}
+	if value > 0 {
+		return errors.Errorf("ranges_unavailable is %v for store %s", value, sample.Store)
+	}
+	return nil
+}
+
+// LiveNodesCheck requires liveness_livenodes, as seen from the pod, to match
+// the cluster's expected size.
+type LiveNodesCheck struct{}
+
+func (LiveNodesCheck) Name() string { return "liveness_livenodes" }
+
+func (c LiveNodesCheck) Evaluate(_ context.Context, sample PodSample) error {
+	value, err := firstMetricValue(sample.Families, "liveness_livenodes")
+	if err != nil {
+		return err
+	}
+	if int32(value) != sample.ClusterSize {
+		return errors.Errorf("liveness_livenodes is %v, want %d", value, sample.ClusterSize)
+	}
+	return nil
+}
+
+// LeaseholderCheck requires replicas_leaseholders for the pod's store to be
+// non-zero, i.e. the store is still holding leases for at least one range.
+type LeaseholderCheck struct{}
+
+func (LeaseholderCheck) Name() string { return "replicas_leaseholders" }
+
+func (c LeaseholderCheck) Evaluate(_ context.Context, sample PodSample) error {
+	value, err := metricByStoreLabel(sample.Families, "replicas_leaseholders", sample.Store)
+	if err != nil {
+		return err
+	}
+	if value <= 0 {
+		return errors.Errorf("replicas_leaseholders is %v for store %s", value, sample.Store)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"context"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func sampleFor(metrics map[string]map[string]float64, store string, clusterSize int32) PodSample {
+	families := make(map[string]*dto.MetricFamily, len(metrics))
+	for name, byStore := range metrics {
+		m := make([]*dto.Metric, 0, len(byStore))
+		for s, v := range byStore {
+			m = append(m, &dto.Metric{
+				Label: []*dto.LabelPair{{Name: strPtr(storeLabelName), Value: strPtr(s)}},
+				Gauge: &dto.Gauge{Value: floatPtr(v)},
+			})
+		}
+		families[name] = &dto.MetricFamily{Metric: m}
+	}
+	return PodSample{PodName: "crdb-0", Store: store, Families: families, ClusterSize: clusterSize}
+}
+
+func TestUnderReplicatedCheck(t *testing.T) {
+	pass := sampleFor(map[string]map[string]float64{"ranges_underreplicated": {"1": 0}}, "1", 3)
+	if err := (UnderReplicatedCheck{}).Evaluate(context.Background(), pass); err != nil {
+		t.Fatalf("expected pass, got %v", err)
+	}
+
+	fail := sampleFor(map[string]map[string]float64{"ranges_underreplicated": {"1": 2}}, "1", 3)
+	if err := (UnderReplicatedCheck{}).Evaluate(context.Background(), fail); err == nil {
+		t.Fatalf("expected failure for nonzero ranges_underreplicated")
+	}
+}
+
+func TestUnavailableRangesCheck(t *testing.T) {
+	pass := sampleFor(map[string]map[string]float64{"ranges_unavailable": {"1": 0}}, "1", 3)
+	if err := (UnavailableRangesCheck{}).Evaluate(context.Background(), pass); err != nil {
+		t.Fatalf("expected pass, got %v", err)
+	}
+
+	fail := sampleFor(map[string]map[string]float64{"ranges_unavailable": {"1": 1}}, "1", 3)
+	if err := (UnavailableRangesCheck{}).Evaluate(context.Background(), fail); err == nil {
+		t.Fatalf("expected failure for nonzero ranges_unavailable")
+	}
+}
+
+func TestLiveNodesCheck(t *testing.T) {
+	families := map[string]*dto.MetricFamily{
+		"liveness_livenodes": {Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: floatPtr(3)}}}},
+	}
+	pass := PodSample{PodName: "crdb-0", Store: "0", Families: families, ClusterSize: 3}
+	if err := (LiveNodesCheck{}).Evaluate(context.Background(), pass); err != nil {
+		t.Fatalf("expected pass, got %v", err)
+	}
+
+	fail := PodSample{PodName: "crdb-0", Store: "0", Families: families, ClusterSize: 4}
+	if err := (LiveNodesCheck{}).Evaluate(context.Background(), fail); err == nil {
+		t.Fatalf("expected failure when liveness_livenodes does not match cluster size")
+	}
+}
+
+func TestLeaseholderCheck(t *testing.T) {
+	pass := sampleFor(map[string]map[string]float64{"replicas_leaseholders": {"1": 5}}, "1", 3)
+	if err := (LeaseholderCheck{}).Evaluate(context.Background(), pass); err != nil {
+		t.Fatalf("expected pass, got %v", err)
+	}
+
+	fail := sampleFor(map[string]map[string]float64{"replicas_leaseholders": {"1": 0}}, "1", 3)
+	if err := (LeaseholderCheck{}).Evaluate(context.Background(), fail); err == nil {
+		t.Fatalf("expected failure for zero replicas_leaseholders")
+	}
+}
+
+func TestDefaultChecksIncludesAllFour(t *testing.T) {
+	checks := defaultChecks()
+	if len(checks) != 4 {
+		t.Fatalf("want 4 default checks, got %d", len(checks))
+	}
+	names := map[string]bool{}
+	for _, c := range checks {
+		names[c.Name()] = true
+	}
+	for _, want := range []string{"ranges_underreplicated", "ranges_unavailable", "liveness_livenodes", "replicas_leaseholders"} {
+		if !names[want] {
+			t.Fatalf("defaultChecks() missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+// Event reasons emitted against the Cluster CR while Probe runs, so a stalled
+// rolling restart is visible on `kubectl describe crdbcluster` instead of only
+// in operator logs.
+const (
+	ReasonProbeStarted           = "ProbeStarted"
+	ReasonUnderReplicatedNonZero = "UnderReplicatedNonZero"
+	ReasonProbeTimeout           = "ProbeTimeout"
+	ReasonProbeSucceeded         = "ProbeSucceeded"
+)
+
+// recordEvent emits a Kubernetes Event against the Cluster CR being probed.
+// It is a no-op when no EventRecorder was wired up, so existing callers and
+// tests that construct a HealthCheckerImpl without one keep working.
+func (hc *HealthCheckerImpl) recordEvent(eventtype, reason, messageFmt string, args ...interface{}) {
+	if hc.recorder == nil {
+		return
+	}
+	hc.recorder.Eventf(hc.cluster.Unwrap(), eventtype, reason, messageFmt, args...)
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/cenkalti/backoff"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/cockroachdb/cockroach-operator/pkg/kube"
@@ -32,17 +33,17 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	"go.uber.org/zap/zapcore"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 )
 
+// default probe timings, used when the Cluster's HealthCheckSpec is unset so
+// existing clusters keep today's behaviour.
 const (
-	underreplicatedmetric = "ranges_underreplicated{store="
-	//TODO: remove the svc.cluster.local
-	cmdunderreplicted   = "curl -ks https://%s.%s:%s/_status/vars | grep 'ranges_underreplicated{'"
-	curlnotfounderr     = "/bin/bash: curl: command not found"
-	sleepBetweenUpdates = 1 * time.Minute
+	defaultMaxElapsedTime = 3 * time.Minute
+	defaultMaxInterval    = 10 * time.Second
+	defaultPostProbeDelay = 22 * time.Second
 )
 
 //HealthChecker interface
@@ -53,25 +54,59 @@ type HealthChecker interface { // for testing
 //HealthCheckerImpl struct
 type HealthCheckerImpl struct {
 	clientset *kubernetes.Clientset
-	scheme    *runtime.Scheme
 	cluster   *resource.Cluster
 	config    *rest.Config
+	scraper   *podMetricsScraper
+	waiter    *ResourceReadyChecker
+	checks    []Check
+	recorder  record.EventRecorder
+
+	maxElapsedTime time.Duration
+	maxInterval    time.Duration
+	postProbeDelay time.Duration
 }
 
-//NewHealthChecker ctor
-func NewHealthChecker(cluster *resource.Cluster, clientset *kubernetes.Clientset, scheme *runtime.Scheme, config *rest.Config) *HealthCheckerImpl {
-	return &HealthCheckerImpl{
-		clientset: clientset,
-		scheme:    scheme,
-		cluster:   cluster,
-		config:    config,
+//NewHealthChecker ctor. It returns an error when the Cluster's HealthCheckSpec
+//fails validation, instead of silently probing with nonsensical timings.
+func NewHealthChecker(cluster *resource.Cluster, clientset *kubernetes.Clientset, config *rest.Config, recorder record.EventRecorder) (*HealthCheckerImpl, error) {
+	spec := cluster.Spec().HealthCheck
+	if err := ValidateHealthCheckSpec(spec); err != nil {
+		return nil, errors.Wrap(err, "invalid HealthCheckSpec")
 	}
+
+	maxElapsedTime, maxInterval, postProbeDelay := defaultMaxElapsedTime, defaultMaxInterval, defaultPostProbeDelay
+	if spec != nil {
+		if spec.MaxElapsedTime.Duration > 0 {
+			maxElapsedTime = spec.MaxElapsedTime.Duration
+		}
+		if spec.MaxInterval.Duration > 0 {
+			maxInterval = spec.MaxInterval.Duration
+		}
+		if spec.PostProbeDelay.Duration > 0 {
+			postProbeDelay = spec.PostProbeDelay.Duration
+		}
+	}
+
+	hc := &HealthCheckerImpl{
+		clientset:      clientset,
+		cluster:        cluster,
+		config:         config,
+		scraper:        newPodMetricsScraper(config, clientset),
+		waiter:         NewResourceReadyChecker(clientset, config),
+		checks:         defaultChecks(),
+		recorder:       recorder,
+		maxElapsedTime: maxElapsedTime,
+		maxInterval:    maxInterval,
+		postProbeDelay: postProbeDelay,
+	}
+	return hc, nil
 }
 
 // Probe will check the ranges_underreplicated metric  for value 0 on all pods after the resart of a
 // pod, before continue the rolling update of the next pod
 func (hc *HealthCheckerImpl) Probe(ctx context.Context, l logr.Logger, logSuffix string, nodeID int) error {
 	l.V(int(zapcore.DebugLevel)).Info("Health check probe", "label", logSuffix, "nodeID", nodeID)
+	hc.recordEvent(corev1.EventTypeNormal, ReasonProbeStarted, "starting health check probe for node %d", nodeID)
 	stsname := hc.cluster.StatefulSetName()
 	stsnamespace := hc.cluster.Namespace()
 
@@ -80,135 +115,114 @@ func (hc *HealthCheckerImpl) Probe(ctx context.Context, l logr.Logger, logSuffix
 		return kube.HandleStsError(err, l, stsname, stsnamespace)
 	}
 
+	// block on the resources a rolling update depends on - PDBs, cert Secrets,
+	// init Jobs - becoming healthy, not just the STS itself.
+	if deps := hc.cluster.DependentResources(); len(deps) > 0 {
+		if err := hc.waiter.WaitForResources(ctx, deps, hc.maxElapsedTime); err != nil {
+			return errors.Wrapf(err, "waiting for dependent resources before probing pod %d", nodeID)
+		}
+	}
+
 	if err := scale.WaitUntilStatefulSetIsReadyToServe(ctx, hc.clientset, stsnamespace, stsname, *sts.Spec.Replicas); err != nil {
 		return errors.Wrapf(err, "error rolling update stategy on pod %d", nodeID)
 	}
-	//validate that curl is installed on all pods with the old and the new version
-	if err := hc.checkUnderReplicatedMetricAllPods(ctx, l, logSuffix, stsname, stsnamespace, *sts.Spec.Replicas); err != nil {
-		if _, ok := err.(CurlNotFoundErr); ok {
-			l.V(int(zapcore.DebugLevel)).Info("curlNotInstalled", "label", logSuffix, "nodeID", nodeID, "fallback to sleeping duration:", sleepBetweenUpdates)
-			time.Sleep(sleepBetweenUpdates)
-			return nil
-		}
-	}
 
-	// we check _status/vars on all cockroachdb pods looking for pairs like
-	// ranges_underreplicated{store="1"} 0 and wait if any are non-zero until all are 0.
-	// We can recheck every 10 seconds. We are waiting for this maximum 3 minutes
-	err = hc.waitUntilUnderReplicatedMetricIsZero(ctx, l, logSuffix, stsname, stsnamespace, *sts.Spec.Replicas)
-	if err != nil {
+	// we scrape _status/vars on all cockroachdb pods and run the full check
+	// chain, waiting if any check fails until they all pass. We can recheck
+	// every hc.maxInterval. We are waiting for this maximum hc.maxElapsedTime
+	if err := hc.waitUntilHealthChecksPass(ctx, l, logSuffix, stsname, stsnamespace, *sts.Spec.Replicas); err != nil {
+		hc.recordEvent(corev1.EventTypeWarning, ReasonProbeTimeout, "health check probe for node %d timed out: %s", nodeID, err)
 		return err
 	}
-	//if curl is not installed we already waited 3 minutes retrying on the container so we exit
-	if _, ok := err.(CurlNotFoundErr); ok {
-		l.V(int(zapcore.DebugLevel)).Info("curlNotInstalled", "label", logSuffix, "nodeID", nodeID)
-		return nil
-	}
 
-	// we will wait 22 seconds and check again  _status/vars on all cockroachdb pods looking for pairs like
-	// ranges_underreplicated{store="1"} 0. This time we do not wait anymore. This suplimentary check
-	// is due to the fact that a node can be evicted in some cases
-	time.Sleep(22 * time.Second)
+	// we will wait hc.postProbeDelay and run the check chain again, with the
+	// same backoff retries as above. This suplimentary check is due to the fact
+	// that a node can be evicted in some cases
+	time.Sleep(hc.postProbeDelay)
 
-	err = hc.waitUntilUnderReplicatedMetricIsZero(ctx, l, logSuffix, stsname, stsnamespace, *sts.Spec.Replicas)
-	if err != nil {
+	if err := hc.waitUntilHealthChecksPass(ctx, l, logSuffix, stsname, stsnamespace, *sts.Spec.Replicas); err != nil {
+		hc.recordEvent(corev1.EventTypeWarning, ReasonProbeTimeout, "health check probe for node %d timed out: %s", nodeID, err)
 		return err
 	}
+
+	hc.recordEvent(corev1.EventTypeNormal, ReasonProbeSucceeded, "health check probe for node %d succeeded", nodeID)
 	return nil
 }
 
-//waitUntilUnderReplicatedMetricIsZero will check _status/vars on all cockroachdb pods looking for pairs like
-//ranges_underreplicated{store="1"} 0 and wait if any are non-zero until all are 0.
-func (hc *HealthCheckerImpl) waitUntilUnderReplicatedMetricIsZero(ctx context.Context, l logr.Logger, logSuffix, stsname, stsnamespace string, replicas int32) error {
+//waitUntilHealthChecksPass runs the check chain on all cockroachdb pods and
+//retries with backoff until every check passes on every pod.
+func (hc *HealthCheckerImpl) waitUntilHealthChecksPass(ctx context.Context, l logr.Logger, logSuffix, stsname, stsnamespace string, replicas int32) error {
 	f := func() error {
-		return hc.checkUnderReplicatedMetricAllPods(ctx, l, logSuffix, stsname, stsnamespace, replicas)
+		return hc.runHealthChecksAllPods(ctx, l, logSuffix, stsname, stsnamespace, replicas)
 	}
 	b := backoff.NewExponentialBackOff()
-	b.MaxElapsedTime = 3 * time.Minute
-	b.MaxInterval = 10 * time.Second
+	b.MaxElapsedTime = hc.maxElapsedTime
+	b.MaxInterval = hc.maxInterval
 	if err := backoff.Retry(f, b); err != nil {
 		return errors.Wrapf(err, "replicas check probe failed for cluster %s", logSuffix)
 	}
 	return nil
 }
 
-//checkUnderReplicatedMetric will check _status/vars on a specific pod looking for pairs like
-//ranges_underreplicated{store="1"} 0
-func (hc *HealthCheckerImpl) checkUnderReplicatedMetric(ctx context.Context, l logr.Logger, logSuffix, podname, stsname, stsnamespace string, partition int32) error {
-	l.V(int(zapcore.DebugLevel)).Info("checkUnderReplicatedMetric", "label", logSuffix, "podname", podname, "partition", partition)
+//evaluatePod scrapes _status/vars once for a pod and runs every registered
+//Check against the resulting metric families, collecting all failures.
+func (hc *HealthCheckerImpl) evaluatePod(ctx context.Context, l logr.Logger, logSuffix, podname, stsname, stsnamespace string, partition, replicas int32) error {
+	l.V(int(zapcore.DebugLevel)).Info("evaluatePod", "label", logSuffix, "podname", podname, "partition", partition)
 	port := strconv.FormatInt(int64(*hc.cluster.Spec().HTTPPort), 10)
-	cmd := []string{
-		"/bin/bash",
-		"-c",
-		fmt.Sprintf(cmdunderreplicted, podname, stsname, port),
-	}
-	l.V(int(zapcore.DebugLevel)).Info("get ranges_underreplicated metric", "node", podname, "underrepmetric", underreplicatedmetric, "cmd", cmd)
-	output, stderr, err := kube.ExecInPod(hc.scheme, hc.config, hc.cluster.Namespace(),
-		podname, resource.DbContainerName, cmd)
-	if stderr != "" {
-		if strings.ContainsAny(stderr, curlnotfounderr) {
-			l.V(int(zapcore.DebugLevel)).Info("CURL not found", "node", podname)
-			return CurlNotFoundErr{
-				Err: errors.Errorf("exec in pod %s failed with stderror: %s ", podname, stderr),
+
+	families, err := hc.scraper.scrape(ctx, podname, stsname, stsnamespace, port)
+	if err != nil {
+		return errors.Wrapf(err, "health check probe for pod %s failed", podname)
+	}
+
+	sample := PodSample{
+		PodName:     podname,
+		Store:       strconv.FormatInt(int64(partition), 10),
+		Families:    families,
+		ClusterSize: replicas,
+	}
+
+	var failures []string
+	for _, check := range hc.checks {
+		if err := check.Evaluate(ctx, sample); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", check.Name(), err))
+			if _, ok := check.(UnderReplicatedCheck); ok {
+				hc.recordEvent(corev1.EventTypeWarning, ReasonUnderReplicatedNonZero,
+					"pod %s store %s: %s", podname, sample.Store, err)
 			}
 		}
-		return errors.Errorf("exec in pod %s failed with stderror: %s ", podname, stderr)
 	}
-	if err != nil {
-		return errors.Wrapf(err, "health check probe for pod %s failed", podname)
+
+	value, _ := underReplicatedRanges(families, sample.Store)
+	status := resource.PodHealthCheckStatus{
+		PodName:       podname,
+		LastProbeTime: metav1.Now(),
+		Metric:        "ranges_underreplicated",
+		Value:         value,
+	}
+	if len(failures) > 0 {
+		status.Message = strings.Join(failures, "; ")
+		hc.cluster.SetPodHealthCheckStatus(status)
+		return errors.Errorf("health check probe for pod %s failed: %s", podname, status.Message)
 	}
-	metric, err := extractMetric(l, output, underreplicatedmetric, partition)
-	l.V(int(zapcore.DebugLevel)).Info("after get ranges_underreplicated metric", "node", podname, "output", output, "metric", metric)
-	return err
+
+	status.LastSuccessTime = status.LastProbeTime
+	status.Message = "all checks passed"
+	hc.cluster.SetPodHealthCheckStatus(status)
+	l.V(int(zapcore.DebugLevel)).Info("all checks passed", "node", podname)
+	return nil
 }
 
-//checkUnderReplicatedMetric will check _status/vars on all cockroachdb pods looking for pairs like
-//ranges_underreplicated{store="1"} 0
-func (hc *HealthCheckerImpl) checkUnderReplicatedMetricAllPods(ctx context.Context, l logr.Logger, logSuffix, stsname, stsnamespace string, replicas int32) error {
-	l.V(int(zapcore.DebugLevel)).Info("checkUnderReplicatedMetric", "label", logSuffix, "replicas", replicas)
+//runHealthChecksAllPods runs the check chain against every cockroachdb pod in
+//the StatefulSet.
+func (hc *HealthCheckerImpl) runHealthChecksAllPods(ctx context.Context, l logr.Logger, logSuffix, stsname, stsnamespace string, replicas int32) error {
+	l.V(int(zapcore.DebugLevel)).Info("runHealthChecksAllPods", "label", logSuffix, "replicas", replicas)
 	for partition := replicas - 1; partition >= 0; partition-- {
 		podName := fmt.Sprintf("%s-%v", stsname, partition)
-		if err := hc.checkUnderReplicatedMetric(ctx, l, logSuffix, podName, stsname, stsnamespace, partition); err != nil {
+		if err := hc.evaluatePod(ctx, l, logSuffix, podName, stsname, stsnamespace, partition, replicas); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
-
-//extractMetric gets the value of the ranges_underreplicated metric for the specific store
-func extractMetric(l logr.Logger, output, underepmetric string, partition int32) (int, error) {
-	l.V(int(zapcore.DebugLevel)).Info("extractMetric", "output", output, "underepmetric", underepmetric, "partition", partition)
-	if output == "" {
-		l.V(int(zapcore.DebugLevel)).Info("output is empty")
-		return -1, errors.Errorf("non existing ranges_underreplicated metric for partition %v", partition)
-	}
-	if !strings.HasPrefix(output, underepmetric) {
-		msg := fmt.Sprintf("incorrect format of the output: actual='%s' expected to start with=%s", output, underepmetric)
-		l.V(int(zapcore.DebugLevel)).Info(msg)
-		return -1, errors.New(msg)
-	}
-	out := strings.Split(output, " ")
-	if out != nil && len(out) <= 1 {
-		return -1, errors.Errorf("incorrect format of the output: actual='%s' expected to start with=%s", output, underepmetric)
-	}
-	metric := strings.TrimSuffix(out[1], "\n")
-	//the value of the metric should be 0 to return nil
-	if i, err := strconv.ParseFloat(metric, 1); err != nil {
-		l.V(int(zapcore.DebugLevel)).Info(err.Error())
-		return -1, err
-	} else if i > 0 {
-		l.V(int(zapcore.DebugLevel)).Info("Metric is greater than 0", "under_replicated", i)
-		return -1, errors.Errorf("under replica is not zero for partition %v", partition)
-	}
-	return 0, nil
-}
-
-//CurlNotFoundErr struct
-type CurlNotFoundErr struct {
-	Err error
-}
-
-func (e CurlNotFoundErr) Error() string {
-	return e.Err.Error()
-}
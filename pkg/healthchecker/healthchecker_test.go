@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+)
+
+// TestNewHealthCheckerPartialSpec guards against the backward-compatible case
+// the request asked for: a cluster setting only one HealthCheckSpec field
+// must keep the other two at their built-in defaults instead of being
+// rejected by validation.
+func TestNewHealthCheckerPartialSpec(t *testing.T) {
+	cluster := resource.NewCluster(nil, "crdb", "default", resource.ClusterSpec{
+		HealthCheck: &resource.HealthCheckSpec{
+			MaxInterval: metav1.Duration{Duration: 5 * time.Second},
+		},
+	})
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: "https://localhost"})
+	if err != nil {
+		t.Fatalf("building clientset: %v", err)
+	}
+
+	hc, err := NewHealthChecker(cluster, clientset, &rest.Config{Host: "https://localhost"}, &record.FakeRecorder{})
+	if err != nil {
+		t.Fatalf("NewHealthChecker with a partial spec returned an error: %v", err)
+	}
+
+	if hc.maxInterval != 5*time.Second {
+		t.Fatalf("want explicitly set maxInterval preserved at 5s, got %s", hc.maxInterval)
+	}
+	if hc.maxElapsedTime != defaultMaxElapsedTime {
+		t.Fatalf("want unset maxElapsedTime defaulted to %s, got %s", defaultMaxElapsedTime, hc.maxElapsedTime)
+	}
+	if hc.postProbeDelay != defaultPostProbeDelay {
+		t.Fatalf("want unset postProbeDelay defaulted to %s, got %s", defaultPostProbeDelay, hc.postProbeDelay)
+	}
+}
+
+func TestNewHealthCheckerRejectsNegativeDuration(t *testing.T) {
+	cluster := resource.NewCluster(nil, "crdb", "default", resource.ClusterSpec{
+		HealthCheck: &resource.HealthCheckSpec{
+			MaxInterval: metav1.Duration{Duration: -time.Second},
+		},
+	})
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: "https://localhost"})
+	if err != nil {
+		t.Fatalf("building clientset: %v", err)
+	}
+
+	if _, err := NewHealthChecker(cluster, clientset, &rest.Config{Host: "https://localhost"}, &record.FakeRecorder{}); err == nil {
+		t.Fatalf("expected an error for a negative maxInterval")
+	}
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+)
+
+// resourceWaiterPollInterval is how often ResourceReadyChecker re-polls a
+// not-yet-ready resource. It mirrors the Helm 3.5 resource status waiter's
+// polling cadence.
+const resourceWaiterPollInterval = 2 * time.Second
+
+// ResourceReadyChecker evaluates readiness for the assorted Kubernetes kinds
+// the operator creates or depends on, the way Helm 3.5's resource status
+// waiters do for `helm install --wait`. HealthCheckerImpl.Probe uses it to
+// block a rolling update not just on the CockroachDB StatefulSet but on every
+// resource the new pods depend on (PDBs, cert Secrets, init Jobs, ...).
+type ResourceReadyChecker struct {
+	clientset     kubernetes.Interface
+	apiextensions apiextensionsclientset.Interface
+}
+
+// NewResourceReadyChecker builds a ResourceReadyChecker. clientset is taken
+// as the kubernetes.Interface rather than the concrete Clientset so tests can
+// substitute k8s.io/client-go/kubernetes/fake. The apiextensions client is
+// best-effort: if it cannot be constructed, CRD readiness checks return a
+// clear error rather than panicking.
+func NewResourceReadyChecker(clientset kubernetes.Interface, config *rest.Config) *ResourceReadyChecker {
+	var apiextensions apiextensionsclientset.Interface
+	if cs, err := apiextensionsclientset.NewForConfig(config); err == nil {
+		apiextensions = cs
+	}
+	return &ResourceReadyChecker{
+		clientset:     clientset,
+		apiextensions: apiextensions,
+	}
+}
+
+// WaitForResources blocks until every resource in refs reports ready, or
+// returns an error once timeout elapses. Lookup errors, including an
+// unsupported kind, are retried until then and the last one is returned.
+func (c *ResourceReadyChecker) WaitForResources(ctx context.Context, refs []kube.ResourceRef, timeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, ref := range refs {
+		if err := c.waitForResource(waitCtx, ref); err != nil {
+			return errors.Wrapf(err, "waiting for %s %s/%s to become ready", ref.Kind, ref.Namespace, ref.Name)
+		}
+	}
+	return nil
+}
+
+func (c *ResourceReadyChecker) waitForResource(ctx context.Context, ref kube.ResourceRef) error {
+	var lastErr error
+	err := wait.PollImmediateUntil(resourceWaiterPollInterval, func() (bool, error) {
+		ready, err := c.isReady(ctx, ref)
+		if err != nil {
+			// transient lookups (not-yet-created resources, API hiccups) keep
+			// polling instead of failing the whole wait immediately.
+			lastErr = err
+			return false, nil
+		}
+		lastErr = nil
+		return ready, nil
+	}, ctx.Done())
+
+	if err != nil {
+		if lastErr != nil {
+			return lastErr
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *ResourceReadyChecker) isReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	switch ref.Kind {
+	case "StatefulSet":
+		return c.statefulSetReady(ctx, ref)
+	case "Deployment":
+		return c.deploymentReady(ctx, ref)
+	case "Service":
+		return c.serviceReady(ctx, ref)
+	case "PersistentVolumeClaim":
+		return c.pvcReady(ctx, ref)
+	case "Secret":
+		return c.secretReady(ctx, ref)
+	case "PodDisruptionBudget":
+		return c.podDisruptionBudgetReady(ctx, ref)
+	case "Job":
+		return c.jobReady(ctx, ref)
+	case "CustomResourceDefinition":
+		return c.crdReady(ctx, ref)
+	default:
+		return false, errors.Errorf("unsupported resource kind %q", ref.Kind)
+	}
+}
+
+// statefulSetReady mirrors Helm's partition-aware RollingUpdate readiness:
+// every replica up through Partition must have rolled to the current
+// revision and be ready.
+func (c *ResourceReadyChecker) statefulSetReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	sts, err := c.clientset.AppsV1().StatefulSets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	var replicas, partition int32
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+	if sts.Spec.UpdateStrategy.RollingUpdate != nil && sts.Spec.UpdateStrategy.RollingUpdate.Partition != nil {
+		partition = *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+	}
+
+	return statefulSetRollingUpdateComplete(statefulSetRolloutState{
+		observedGeneration: sts.Status.ObservedGeneration,
+		generation:         sts.Generation,
+		replicas:           replicas,
+		readyReplicas:      sts.Status.ReadyReplicas,
+		updatedReplicas:    sts.Status.UpdatedReplicas,
+		updateRevision:     sts.Status.UpdateRevision,
+		currentRevision:    sts.Status.CurrentRevision,
+		partition:          partition,
+	}), nil
+}
+
+// statefulSetRolloutState is the subset of a StatefulSet's spec/status that
+// determines whether its rolling update has reached the given partition.
+// It exists so statefulSetRollingUpdateComplete can be unit tested without a
+// Kubernetes client.
+type statefulSetRolloutState struct {
+	observedGeneration int64
+	generation         int64
+	replicas           int32
+	readyReplicas      int32
+	updatedReplicas    int32
+	updateRevision     string
+	currentRevision    string
+	partition          int32
+}
+
+// statefulSetRollingUpdateComplete reports whether every replica up through
+// partition has rolled to updateRevision and all replicas are ready.
+func statefulSetRollingUpdateComplete(s statefulSetRolloutState) bool {
+	if s.observedGeneration < s.generation {
+		return false
+	}
+	if s.readyReplicas < s.replicas {
+		return false
+	}
+	if s.updateRevision != s.currentRevision {
+		if want := s.replicas - s.partition; s.updatedReplicas < want {
+			return false
+		}
+	}
+	return true
+}
+
+// deploymentReady follows the same Progressing/Available condition checks
+// Kubernetes' own deploymentutil.GetDeploymentCondition helper uses.
+func (c *ResourceReadyChecker) deploymentReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	dep, err := c.clientset.AppsV1().Deployments(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if dep.Status.ObservedGeneration < dep.Generation {
+		return false, nil
+	}
+	if dep.Spec.Replicas != nil && dep.Status.UpdatedReplicas < *dep.Spec.Replicas {
+		return false, nil
+	}
+	if dep.Status.Replicas > dep.Status.UpdatedReplicas {
+		return false, nil
+	}
+	if dep.Status.AvailableReplicas < dep.Status.UpdatedReplicas {
+		return false, nil
+	}
+	for _, cond := range dep.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return false, errors.Errorf("deployment %s exceeded its progress deadline", ref.Name)
+		}
+		if cond.Type == appsv1.DeploymentAvailable && cond.Status != corev1.ConditionTrue {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// serviceReady requires the Service to have at least one address backing it,
+// i.e. its Endpoints object has populated subsets.
+func (c *ResourceReadyChecker) serviceReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	if _, err := c.clientset.CoreV1().Services(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{}); err != nil {
+		return false, err
+	}
+	endpoints, err := c.clientset.CoreV1().Endpoints(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// secretReady requires the Secret to exist. Secrets (unlike the other kinds
+// here) carry no readiness condition of their own - existence is all a
+// dependent pod needs.
+func (c *ResourceReadyChecker) secretReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	if _, err := c.clientset.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *ResourceReadyChecker) pvcReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	pvc, err := c.clientset.CoreV1().PersistentVolumeClaims(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return pvc.Status.Phase == corev1.ClaimBound, nil
+}
+
+func (c *ResourceReadyChecker) podDisruptionBudgetReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	pdb, err := c.clientset.PolicyV1beta1().PodDisruptionBudgets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	return pdb.Status.CurrentHealthy >= pdb.Status.DesiredHealthy, nil
+}
+
+func (c *ResourceReadyChecker) jobReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	job, err := c.clientset.BatchV1().Jobs(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobComplete && cond.Status == corev1.ConditionTrue {
+			return true, nil
+		}
+		if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+			return false, errors.Errorf("job %s failed: %s", ref.Name, cond.Message)
+		}
+	}
+	return false, nil
+}
+
+func (c *ResourceReadyChecker) crdReady(ctx context.Context, ref kube.ResourceRef) (bool, error) {
+	if c.apiextensions == nil {
+		return false, errors.New("apiextensions client unavailable")
+	}
+	crd, err := c.apiextensions.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	established, namesAccepted := false, false
+	for _, cond := range crd.Status.Conditions {
+		switch cond.Type {
+		case "Established":
+			established = cond.Status == "True"
+		case "NamesAccepted":
+			namesAccepted = cond.Status == "True"
+		}
+	}
+	return established && namesAccepted, nil
+}
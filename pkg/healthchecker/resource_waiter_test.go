@@ -0,0 +1,277 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+)
+
+func TestStatefulSetRollingUpdateComplete(t *testing.T) {
+	tests := []struct {
+		name  string
+		state statefulSetRolloutState
+		want  bool
+	}{
+		{
+			name: "fully rolled out, same revision",
+			state: statefulSetRolloutState{
+				observedGeneration: 2, generation: 2,
+				replicas: 3, readyReplicas: 3, updatedReplicas: 3,
+				updateRevision: "rev-1", currentRevision: "rev-1",
+			},
+			want: true,
+		},
+		{
+			name: "status not yet observed at current generation",
+			state: statefulSetRolloutState{
+				observedGeneration: 1, generation: 2,
+				replicas: 3, readyReplicas: 3, updatedReplicas: 3,
+			},
+			want: false,
+		},
+		{
+			name: "not all replicas ready",
+			state: statefulSetRolloutState{
+				observedGeneration: 1, generation: 1,
+				replicas: 3, readyReplicas: 2, updatedReplicas: 2,
+			},
+			want: false,
+		},
+		{
+			name: "rolling update in progress, partition not yet reached",
+			state: statefulSetRolloutState{
+				observedGeneration: 1, generation: 1,
+				replicas: 3, readyReplicas: 3, updatedReplicas: 1,
+				updateRevision: "rev-2", currentRevision: "rev-1",
+				partition: 1, // replicas 1 and 2 must be updated; only 1 is
+			},
+			want: false,
+		},
+		{
+			name: "rolling update reached its partition",
+			state: statefulSetRolloutState{
+				observedGeneration: 1, generation: 1,
+				replicas: 3, readyReplicas: 3, updatedReplicas: 2,
+				updateRevision: "rev-2", currentRevision: "rev-1",
+				partition: 1, // replicas 1 and 2 updated, replica 0 held back
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statefulSetRollingUpdateComplete(tt.state); got != tt.want {
+				t.Fatalf("statefulSetRollingUpdateComplete(%+v) = %v, want %v", tt.state, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeploymentReady(t *testing.T) {
+	ref := kube.ResourceRef{Kind: "Deployment", Namespace: "default", Name: "dep"}
+	replicas := int32(3)
+
+	base := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace, Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           3,
+			UpdatedReplicas:    3,
+			AvailableReplicas:  3,
+			Conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+
+	progressDeadlineExceeded := base.DeepCopy()
+	progressDeadlineExceeded.Status.Conditions = []appsv1.DeploymentCondition{
+		{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"},
+	}
+
+	tests := []struct {
+		name    string
+		dep     *appsv1.Deployment
+		want    bool
+		wantErr bool
+	}{
+		{name: "fully rolled out and available", dep: &base, want: true},
+		{name: "progress deadline exceeded surfaces as an error", dep: progressDeadlineExceeded, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tt.dep)
+			c := &ResourceReadyChecker{clientset: clientset}
+
+			ready, err := c.deploymentReady(context.Background(), ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ready != tt.want {
+				t.Fatalf("deploymentReady() = %v, want %v", ready, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobReady(t *testing.T) {
+	ref := kube.ResourceRef{Kind: "Job", Namespace: "default", Name: "init"}
+
+	complete := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+		},
+	}
+	failed := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace},
+		Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "backoff limit exceeded"}},
+		},
+	}
+	running := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace},
+	}
+
+	tests := []struct {
+		name    string
+		job     *batchv1.Job
+		want    bool
+		wantErr bool
+	}{
+		{name: "complete", job: complete, want: true},
+		{name: "still running", job: running, want: false},
+		{name: "failed surfaces as an error", job: failed, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tt.job)
+			c := &ResourceReadyChecker{clientset: clientset}
+
+			ready, err := c.jobReady(context.Background(), ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ready != tt.want {
+				t.Fatalf("jobReady() = %v, want %v", ready, tt.want)
+			}
+		})
+	}
+}
+
+func TestCRDReady(t *testing.T) {
+	ref := kube.ResourceRef{Kind: "CustomResourceDefinition", Name: "crdbclusters.crdb.cockroachlabs.com"}
+
+	established := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: ref.Name},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			Conditions: []apiextensionsv1.CustomResourceDefinitionCondition{
+				{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue},
+				{Type: apiextensionsv1.NamesAccepted, Status: apiextensionsv1.ConditionTrue},
+			},
+		},
+	}
+	notEstablished := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: ref.Name},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			Conditions: []apiextensionsv1.CustomResourceDefinitionCondition{
+				{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionFalse},
+				{Type: apiextensionsv1.NamesAccepted, Status: apiextensionsv1.ConditionTrue},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		crd  *apiextensionsv1.CustomResourceDefinition
+		want bool
+	}{
+		{name: "established and names accepted", crd: established, want: true},
+		{name: "names accepted but not yet established", crd: notEstablished, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ResourceReadyChecker{apiextensions: apiextensionsfake.NewSimpleClientset(tt.crd)}
+
+			ready, err := c.crdReady(context.Background(), ref)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ready != tt.want {
+				t.Fatalf("crdReady() = %v, want %v", ready, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretReady(t *testing.T) {
+	ref := kube.ResourceRef{Kind: "Secret", Namespace: "default", Name: "crdb-node"}
+
+	t.Run("exists", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace}})
+		c := &ResourceReadyChecker{clientset: clientset}
+
+		ready, err := c.secretReady(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !ready {
+			t.Fatalf("secretReady() = false, want true")
+		}
+	})
+
+	t.Run("not yet created", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		c := &ResourceReadyChecker{clientset: clientset}
+
+		ready, err := c.secretReady(context.Background(), ref)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ready {
+			t.Fatalf("secretReady() = true, want false")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func strPtr(s string) *string     { return &s }
+func floatPtr(f float64) *float64 { return &f }
+
+func familiesWithStoreGauge(metric string, values map[string]float64) map[string]*dto.MetricFamily {
+	m := make([]*dto.Metric, 0, len(values))
+	for store, value := range values {
+		m = append(m, &dto.Metric{
+			Label: []*dto.LabelPair{
+				{Name: strPtr(storeLabelName), Value: strPtr(store)},
+			},
+			Gauge: &dto.Gauge{Value: floatPtr(value)},
+		})
+	}
+	return map[string]*dto.MetricFamily{
+		metric: {Metric: m},
+	}
+}
+
+func TestMetricByStoreLabel(t *testing.T) {
+	families := familiesWithStoreGauge("ranges_underreplicated", map[string]float64{
+		"1": 0,
+		"2": 3,
+	})
+
+	value, err := metricByStoreLabel(families, "ranges_underreplicated", "2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != 3 {
+		t.Fatalf("want 3, got %v", value)
+	}
+
+	if _, err := metricByStoreLabel(families, "ranges_underreplicated", "9"); err == nil {
+		t.Fatalf("expected error for missing store")
+	}
+	if _, err := metricByStoreLabel(families, "does_not_exist", "1"); err == nil {
+		t.Fatalf("expected error for missing metric family")
+	}
+}
+
+func TestUnderReplicatedRanges(t *testing.T) {
+	families := familiesWithStoreGauge("ranges_underreplicated", map[string]float64{"1": 5})
+
+	value, err := underReplicatedRanges(families, "1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != 5 {
+		t.Fatalf("want 5, got %v", value)
+	}
+}
+
+func TestFirstMetricValue(t *testing.T) {
+	families := map[string]*dto.MetricFamily{
+		"liveness_livenodes": {
+			Metric: []*dto.Metric{
+				{Gauge: &dto.Gauge{Value: floatPtr(3)}},
+			},
+		},
+	}
+
+	value, err := firstMetricValue(families, "liveness_livenodes")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != 3 {
+		t.Fatalf("want 3, got %v", value)
+	}
+
+	if _, err := firstMetricValue(families, "missing"); err == nil {
+		t.Fatalf("expected error for missing metric family")
+	}
+
+	empty := map[string]*dto.MetricFamily{"empty": {Metric: nil}}
+	if _, err := firstMetricValue(empty, "empty"); err == nil {
+		t.Fatalf("expected error for metric family with no samples")
+	}
+}
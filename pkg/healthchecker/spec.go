@@ -0,0 +1,47 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+)
+
+// ValidateHealthCheckSpec rejects a Cluster's HealthCheckSpec when any
+// duration it sets is negative. A nil spec, or a zero-valued duration within
+// it, is valid - metav1.Duration has no way to distinguish "unset" from
+// "explicitly zero", and NewHealthChecker falls back to the built-in default
+// for any field left at zero, so zero must mean "use the default", not
+// "reject".
+func ValidateHealthCheckSpec(spec *resource.HealthCheckSpec) error {
+	if spec == nil {
+		return nil
+	}
+
+	durations := map[string]int64{
+		"maxElapsedTime": spec.MaxElapsedTime.Duration.Nanoseconds(),
+		"maxInterval":    spec.MaxInterval.Duration.Nanoseconds(),
+		"postProbeDelay": spec.PostProbeDelay.Duration.Nanoseconds(),
+	}
+	for field, value := range durations {
+		if value < 0 {
+			return errors.Errorf("healthCheck.%s must not be negative", field)
+		}
+	}
+	return nil
+}
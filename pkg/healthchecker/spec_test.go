@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/resource"
+)
+
+func TestValidateHealthCheckSpec(t *testing.T) {
+	duration := func(d time.Duration) metav1.Duration {
+		return metav1.Duration{Duration: d}
+	}
+
+	tests := []struct {
+		name    string
+		spec    *resource.HealthCheckSpec
+		wantErr bool
+	}{
+		{name: "nil spec is valid", spec: nil, wantErr: false},
+		{
+			name: "all positive is valid",
+			spec: &resource.HealthCheckSpec{
+				MaxElapsedTime: duration(time.Minute),
+				MaxInterval:    duration(time.Second),
+				PostProbeDelay: duration(time.Second),
+			},
+			wantErr: false,
+		},
+		{
+			name: "zero maxElapsedTime is valid - it means use the default",
+			spec: &resource.HealthCheckSpec{
+				MaxElapsedTime: duration(0),
+				MaxInterval:    duration(time.Second),
+				PostProbeDelay: duration(time.Second),
+			},
+			wantErr: false,
+		},
+		{
+			name:    "all zero is valid - an all-default partial spec",
+			spec:    &resource.HealthCheckSpec{},
+			wantErr: false,
+		},
+		{
+			name: "negative maxElapsedTime is invalid",
+			spec: &resource.HealthCheckSpec{
+				MaxElapsedTime: duration(-time.Minute),
+				MaxInterval:    duration(time.Second),
+				PostProbeDelay: duration(time.Second),
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative maxInterval is invalid",
+			spec: &resource.HealthCheckSpec{
+				MaxElapsedTime: duration(time.Minute),
+				MaxInterval:    duration(-time.Second),
+				PostProbeDelay: duration(time.Second),
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative postProbeDelay is invalid",
+			spec: &resource.HealthCheckSpec{
+				MaxElapsedTime: duration(time.Minute),
+				MaxInterval:    duration(time.Second),
+				PostProbeDelay: duration(-time.Second),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHealthCheckSpec(tt.spec)
+			if tt.wantErr && err == nil {
+				t.Fatalf("expected an error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resource wraps the CockroachDB CrdbCluster custom resource with the
+// accessors the rest of the operator, including the health checker, use to
+// read its spec and report status back onto it.
+package resource
+
+import (
+	"fmt"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+)
+
+// DbContainerName is the name of the cockroachdb container in the StatefulSet
+// pod template.
+const DbContainerName = "db"
+
+// ClusterSpec is the subset of the CrdbCluster CRD spec the health checker
+// consumes.
+type ClusterSpec struct {
+	// HTTPPort is the CockroachDB pod's status/metrics port.
+	HTTPPort *int32 `json:"httpPort,omitempty"`
+	// HealthCheck tunes HealthCheckerImpl's probe cadence for this cluster.
+	// A nil value keeps the package's built-in defaults.
+	HealthCheck *HealthCheckSpec `json:"healthCheck,omitempty"`
+}
+
+// HealthCheckSpec lets an operator tune the rolling-update health probe's
+// timing instead of relying on healthchecker's hardcoded defaults.
+type HealthCheckSpec struct {
+	// MaxElapsedTime bounds how long the probe retries before giving up.
+	MaxElapsedTime metav1.Duration `json:"maxElapsedTime,omitempty"`
+	// MaxInterval caps the exponential backoff between probe retries.
+	MaxInterval metav1.Duration `json:"maxInterval,omitempty"`
+	// PostProbeDelay is the extra wait before the supplementary check that
+	// guards against a node being evicted right after the probe passes.
+	PostProbeDelay metav1.Duration `json:"postProbeDelay,omitempty"`
+}
+
+// PodHealthCheckStatus records the most recent health check probe result for
+// a single pod, surfaced on the Cluster CR's status so `kubectl describe
+// crdbcluster` is actionable while a rolling restart is stuck.
+type PodHealthCheckStatus struct {
+	PodName         string      `json:"podName"`
+	LastProbeTime   metav1.Time `json:"lastProbeTime,omitempty"`
+	LastSuccessTime metav1.Time `json:"lastSuccessTime,omitempty"`
+	Metric          string      `json:"metric,omitempty"`
+	Value           float64     `json:"value,omitempty"`
+	Message         string      `json:"message,omitempty"`
+}
+
+// ClusterStatus is the subset of CrdbCluster.Status the health checker reads
+// and writes.
+type ClusterStatus struct {
+	// HealthChecks holds the latest probe result per pod, keyed by PodName.
+	HealthChecks []PodHealthCheckStatus `json:"healthChecks,omitempty"`
+}
+
+// Cluster wraps a CrdbCluster custom resource, exposing the accessors and
+// status helpers used outside the controller package.
+type Cluster struct {
+	mu sync.Mutex
+
+	object      runtime.Object
+	name        string
+	namespace   string
+	spec        ClusterSpec
+	status      ClusterStatus
+	initialized bool
+}
+
+// NewCluster builds a Cluster wrapper around a CrdbCluster object.
+func NewCluster(object runtime.Object, name, namespace string, spec ClusterSpec) *Cluster {
+	return &Cluster{object: object, name: name, namespace: namespace, spec: spec}
+}
+
+// StatefulSetName returns the name of the StatefulSet running CockroachDB for
+// this cluster.
+func (c *Cluster) StatefulSetName() string {
+	return c.name
+}
+
+// Namespace returns the cluster's namespace.
+func (c *Cluster) Namespace() string {
+	return c.namespace
+}
+
+// Spec returns the cluster's spec.
+func (c *Cluster) Spec() ClusterSpec {
+	return c.spec
+}
+
+// Unwrap returns the underlying CrdbCluster object, e.g. for attaching
+// Kubernetes Events to it.
+func (c *Cluster) Unwrap() runtime.Object {
+	return c.object
+}
+
+// Status returns a copy of the cluster's current status, including any
+// HealthChecks recorded via SetPodHealthCheckStatus.
+func (c *Cluster) Status() ClusterStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.status
+	status.HealthChecks = append([]PodHealthCheckStatus(nil), c.status.HealthChecks...)
+	return status
+}
+
+// SetPodHealthCheckStatus upserts status into the Cluster's HealthChecks
+// status slice, keyed by PodName. The caller (the controller's reconcile
+// loop) is responsible for persisting the CrdbCluster object's status
+// subresource after Probe returns - this method only updates the in-memory
+// wrapper.
+func (c *Cluster) SetPodHealthCheckStatus(status PodHealthCheckStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, existing := range c.status.HealthChecks {
+		if existing.PodName == status.PodName {
+			c.status.HealthChecks[i] = status
+			return
+		}
+	}
+	c.status.HealthChecks = append(c.status.HealthChecks, status)
+}
+
+// SetInitialized records whether the cluster has already completed its
+// one-time `cockroach init` run, so DependentResources stops waiting on the
+// (by-then-deleted) init Job.
+func (c *Cluster) SetInitialized(initialized bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.initialized = initialized
+}
+
+// DependentResources returns the resources created alongside the CockroachDB
+// StatefulSet that a rolling update must also wait on before it is safe to
+// restart the next pod: the pod disruption budget guarding availability, the
+// node TLS cert Secret, and - until the cluster has initialized once - the
+// cluster-init Job.
+func (c *Cluster) DependentResources() []kube.ResourceRef {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	refs := []kube.ResourceRef{
+		{Kind: "PodDisruptionBudget", Namespace: c.namespace, Name: c.name},
+		{Kind: "Secret", Namespace: c.namespace, Name: fmt.Sprintf("%s-node", c.name)},
+	}
+	if !c.initialized {
+		refs = append(refs, kube.ResourceRef{Kind: "Job", Namespace: c.namespace, Name: fmt.Sprintf("%s-init", c.name)})
+	}
+	return refs
+}
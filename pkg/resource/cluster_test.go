@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Cockroach Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach-operator/pkg/kube"
+)
+
+func containsKind(refs []kube.ResourceRef, kind string) bool {
+	for _, ref := range refs {
+		if ref.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSetPodHealthCheckStatusUpsert(t *testing.T) {
+	c := NewCluster(nil, "crdb", "default", ClusterSpec{})
+
+	c.SetPodHealthCheckStatus(PodHealthCheckStatus{PodName: "crdb-0", Message: "first"})
+	c.SetPodHealthCheckStatus(PodHealthCheckStatus{PodName: "crdb-1", Message: "first"})
+	c.SetPodHealthCheckStatus(PodHealthCheckStatus{PodName: "crdb-0", Message: "second"})
+
+	statuses := c.Status().HealthChecks
+	if len(statuses) != 2 {
+		t.Fatalf("want 2 statuses, got %d", len(statuses))
+	}
+	for _, s := range statuses {
+		if s.PodName == "crdb-0" && s.Message != "second" {
+			t.Fatalf("want crdb-0 status updated in place to %q, got %q", "second", s.Message)
+		}
+	}
+}
+
+func TestDependentResourcesIncludesInitJobUntilInitialized(t *testing.T) {
+	c := NewCluster(nil, "crdb", "default", ClusterSpec{})
+
+	refs := c.DependentResources()
+	if !containsKind(refs, "Job") {
+		t.Fatalf("expected init Job dependency before the cluster has initialized, got %+v", refs)
+	}
+
+	c.SetInitialized(true)
+	refs = c.DependentResources()
+	if containsKind(refs, "Job") {
+		t.Fatalf("expected no Job dependency after the cluster has initialized, got %+v", refs)
+	}
+	if !containsKind(refs, "PodDisruptionBudget") || !containsKind(refs, "Secret") {
+		t.Fatalf("expected PDB and Secret dependencies regardless of init state, got %+v", refs)
+	}
+}